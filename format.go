@@ -0,0 +1,39 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import "encoding/json"
+
+// jsonRecord is the wire representation emitted by JSONFormatter: one
+// object per line, {"ts":...,"level":...,"src":...,"msg":...,"fields":{...}}.
+// Fields is omitted when the record carries none, e.g. it wasn't logged
+// through a Logger.WithFields.
+type jsonRecord struct {
+	Timestamp string                 `json:"ts"`
+	Level     string                 `json:"level"`
+	Source    string                 `json:"src"`
+	Message   string                 `json:"msg"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// JSONFormatter renders a LogRecord as a single line of JSON. It is used
+// by SetJSONFormat on FileLogWriter and SocketLogWriter, so both writers
+// emit the same structured shape once it is enabled. SocketLogWriter's
+// default SocketFormatJSON framing still uses json.Marshal(rec).
+type JSONFormatter struct{}
+
+// Format renders rec as one JSON object followed by a newline.
+func (JSONFormatter) Format(rec *LogRecord) ([]byte, error) {
+	js, err := json.Marshal(jsonRecord{
+		Timestamp: rec.Created.Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:     levelStrings[rec.Level],
+		Source:    rec.Source,
+		Message:   rec.Message,
+		Fields:    rec.Fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(js, '\n'), nil
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// recordingWriter captures every record it receives, for assertions.
+type recordingWriter struct {
+	recs []*LogRecord
+}
+
+func (w *recordingWriter) LogWrite(rec *LogRecord) { w.recs = append(w.recs, rec) }
+func (w *recordingWriter) Close()                  {}
+
+func TestLoggerWithFieldsMergesIntoRecord(t *testing.T) {
+	w := &recordingWriter{}
+	log := NewLogger().AddFilter("test", INFO, w)
+
+	child := log.WithFields(map[string]interface{}{"request_id": "abc123"})
+	child.Info("hello")
+
+	if len(w.recs) != 1 {
+		t.Fatalf("got %d records, want 1", len(w.recs))
+	}
+
+	rec := w.recs[0]
+	if rec.Fields["request_id"] != "abc123" {
+		t.Fatalf("rec.Fields = %v, want request_id=abc123", rec.Fields)
+	}
+
+	js, err := JSONFormatter{}.Format(rec)
+	if err != nil {
+		t.Fatalf("Format: %s", err)
+	}
+
+	var decoded struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(js, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+	if decoded.Fields["request_id"] != "abc123" {
+		t.Fatalf("decoded fields = %v, want request_id=abc123", decoded.Fields)
+	}
+}
+
+func TestFieldLoggerWithFieldsMerges(t *testing.T) {
+	w := &recordingWriter{}
+	log := NewLogger().AddFilter("test", INFO, w)
+
+	base := log.WithFields(map[string]interface{}{"service": "api"})
+	child := base.WithFields(map[string]interface{}{"request_id": "abc123"})
+	child.Info("hello")
+
+	rec := w.recs[0]
+	if rec.Fields["service"] != "api" || rec.Fields["request_id"] != "abc123" {
+		t.Fatalf("rec.Fields = %v, want both service and request_id", rec.Fields)
+	}
+
+	// base's own fields weren't mutated by child.WithFields.
+	base.Info("bare")
+	baseRec := w.recs[1]
+	if _, ok := baseRec.Fields["request_id"]; ok {
+		t.Fatalf("base.Fields leaked request_id from child: %v", baseRec.Fields)
+	}
+}
+
+func TestJSONFormatterOmitsEmptyFields(t *testing.T) {
+	js, err := JSONFormatter{}.Format(&LogRecord{Message: "hi"})
+	if err != nil {
+		t.Fatalf("Format: %s", err)
+	}
+	if string(js) != `{"ts":"0001-01-01T00:00:00.000Z","level":"FNST","src":"","msg":"hi"}`+"\n" {
+		t.Fatalf("unexpected output: %s", js)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a LogRecord, from most to least verbose.
+type Level int
+
+const (
+	FINEST Level = iota
+	FINE
+	DEBUG
+	TRACE
+	INFO
+	WARNING
+	ERROR
+	CRITICAL
+)
+
+var levelStrings = [...]string{"FNST", "FINE", "DEBG", "TRAC", "INFO", "WARN", "EROR", "CRIT"}
+
+// LogBufferLength is the default capacity of a LogWriter's input channel,
+// i.e. how many records can queue up before LogWrite blocks.
+const LogBufferLength = 32
+
+// LogRecord is a single logged message, as handed to a LogWriter's
+// LogWrite.
+type LogRecord struct {
+	Level   Level
+	Created time.Time
+	Source  string
+	Message string
+
+	// Fields carries the contextual key/value pairs attached via
+	// Logger.WithFields. JSONFormatter renders them under "fields"; the
+	// pattern formatter (FormatLogRecord) has no slot for them, since
+	// %D %T %L %S %M is a fixed line shape.
+	Fields map[string]interface{}
+}
+
+// LogWriter is anything that can receive and persist LogRecords: a
+// FileLogWriter, SocketLogWriter, or ConsoleLogWriter.
+type LogWriter interface {
+	LogWrite(rec *LogRecord)
+	Close()
+}
+
+// FormatLogRecord renders rec according to format, substituting:
+//
+//	%D - Date (01/02/06)
+//	%T - Time (15:04:05)
+//	%L - Level
+//	%S - Source
+//	%M - Message
+//
+// and appending a trailing newline. An empty format renders to "" (used
+// for a disabled header/trailer).
+func FormatLogRecord(format string, rec *LogRecord) string {
+	if format == "" {
+		return ""
+	}
+
+	r := strings.NewReplacer(
+		"%D", rec.Created.Format("01/02/06"),
+		"%T", rec.Created.Format("15:04:05"),
+		"%L", levelStrings[rec.Level],
+		"%S", rec.Source,
+		"%M", rec.Message,
+	)
+
+	return r.Replace(format) + "\n"
+}
+
+// Filter pairs a LogWriter with the minimum Level it accepts.
+type Filter struct {
+	Level Level
+	LogWriter
+}
+
+// Logger dispatches LogRecords to a set of named Filters, each with its
+// own minimum level.
+type Logger map[string]*Filter
+
+// NewLogger creates an empty Logger with no filters.
+func NewLogger() Logger {
+	return make(Logger)
+}
+
+// AddFilter registers w under name, accepting records at lvl or above
+// (chainable).
+func (log Logger) AddFilter(name string, lvl Level, w LogWriter) Logger {
+	log[name] = &Filter{Level: lvl, LogWriter: w}
+	return log
+}
+
+// Close closes every filter's LogWriter and removes it from log.
+func (log Logger) Close() {
+	for name, filt := range log {
+		filt.Close()
+		delete(log, name)
+	}
+}
+
+// dispatch builds a LogRecord and sends it to every filter at or below
+// its own Level.
+func (log Logger) dispatch(lvl Level, source, message string, fields map[string]interface{}) {
+	rec := &LogRecord{
+		Level:   lvl,
+		Created: time.Now(),
+		Source:  source,
+		Message: message,
+		Fields:  fields,
+	}
+
+	for _, filt := range log {
+		if lvl < filt.Level {
+			continue
+		}
+		filt.LogWrite(rec)
+	}
+}
+
+// WithFields returns a FieldLogger sharing log's filters that merges
+// fields into every record it emits. log itself keeps logging without
+// them.
+func (log Logger) WithFields(fields map[string]interface{}) *FieldLogger {
+	return &FieldLogger{logger: log, fields: cloneFields(fields)}
+}
+
+// FieldLogger is a Logger bound to a fixed set of contextual fields,
+// merged into every record it logs, as returned by Logger.WithFields. It
+// shares the parent Logger's filters, so a filter added to the parent
+// is visible through it too.
+type FieldLogger struct {
+	logger Logger
+	fields map[string]interface{}
+}
+
+// WithFields returns a child FieldLogger merging additional fields on top
+// of fl's own; keys in fields win over fl's on collision.
+func (fl *FieldLogger) WithFields(fields map[string]interface{}) *FieldLogger {
+	merged := cloneFields(fl.fields)
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &FieldLogger{logger: fl.logger, fields: merged}
+}
+
+func cloneFields(fields map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out
+}
+
+// callerSource returns "file:line" for the frame calldepth levels above
+// callerSource itself (as runtime.Caller counts), so 2 from a Logger
+// method names that method's caller, matching the %S source format
+// logged records carry.
+func callerSource(calldepth int) string {
+	_, file, line, ok := runtime.Caller(calldepth)
+	if !ok {
+		return "???"
+	}
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		file = file[i+1:]
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+func logf(lvl Level, arg0 string, args []interface{}) string {
+	if len(args) > 0 {
+		return fmt.Sprintf(arg0, args...)
+	}
+	return arg0
+}
+
+// Finest logs a message at the FINEST level, formatting arg0 with args
+// via fmt.Sprintf when args is non-empty.
+func (log Logger) Finest(arg0 string, args ...interface{}) {
+	log.dispatch(FINEST, callerSource(2), logf(FINEST, arg0, args), nil)
+}
+
+// Fine logs a message at the FINE level.
+func (log Logger) Fine(arg0 string, args ...interface{}) {
+	log.dispatch(FINE, callerSource(2), logf(FINE, arg0, args), nil)
+}
+
+// Debug logs a message at the DEBUG level.
+func (log Logger) Debug(arg0 string, args ...interface{}) {
+	log.dispatch(DEBUG, callerSource(2), logf(DEBUG, arg0, args), nil)
+}
+
+// Trace logs a message at the TRACE level.
+func (log Logger) Trace(arg0 string, args ...interface{}) {
+	log.dispatch(TRACE, callerSource(2), logf(TRACE, arg0, args), nil)
+}
+
+// Info logs a message at the INFO level.
+func (log Logger) Info(arg0 string, args ...interface{}) {
+	log.dispatch(INFO, callerSource(2), logf(INFO, arg0, args), nil)
+}
+
+// Warn logs a message at the WARNING level.
+func (log Logger) Warn(arg0 string, args ...interface{}) {
+	log.dispatch(WARNING, callerSource(2), logf(WARNING, arg0, args), nil)
+}
+
+// Error logs a message at the ERROR level.
+func (log Logger) Error(arg0 string, args ...interface{}) {
+	log.dispatch(ERROR, callerSource(2), logf(ERROR, arg0, args), nil)
+}
+
+// Critical logs a message at the CRITICAL level.
+func (log Logger) Critical(arg0 string, args ...interface{}) {
+	log.dispatch(CRITICAL, callerSource(2), logf(CRITICAL, arg0, args), nil)
+}
+
+// Finest logs a message at the FINEST level, merging fl's fields in.
+func (fl *FieldLogger) Finest(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(FINEST, callerSource(2), logf(FINEST, arg0, args), fl.fields)
+}
+
+// Fine logs a message at the FINE level, merging fl's fields in.
+func (fl *FieldLogger) Fine(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(FINE, callerSource(2), logf(FINE, arg0, args), fl.fields)
+}
+
+// Debug logs a message at the DEBUG level, merging fl's fields in.
+func (fl *FieldLogger) Debug(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(DEBUG, callerSource(2), logf(DEBUG, arg0, args), fl.fields)
+}
+
+// Trace logs a message at the TRACE level, merging fl's fields in.
+func (fl *FieldLogger) Trace(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(TRACE, callerSource(2), logf(TRACE, arg0, args), fl.fields)
+}
+
+// Info logs a message at the INFO level, merging fl's fields in.
+func (fl *FieldLogger) Info(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(INFO, callerSource(2), logf(INFO, arg0, args), fl.fields)
+}
+
+// Warn logs a message at the WARNING level, merging fl's fields in.
+func (fl *FieldLogger) Warn(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(WARNING, callerSource(2), logf(WARNING, arg0, args), fl.fields)
+}
+
+// Error logs a message at the ERROR level, merging fl's fields in.
+func (fl *FieldLogger) Error(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(ERROR, callerSource(2), logf(ERROR, arg0, args), fl.fields)
+}
+
+// Critical logs a message at the CRITICAL level, merging fl's fields in.
+func (fl *FieldLogger) Critical(arg0 string, args ...interface{}) {
+	fl.logger.dispatch(CRITICAL, callerSource(2), logf(CRITICAL, arg0, args), fl.fields)
+}
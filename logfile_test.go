@@ -0,0 +1,328 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTailFollowAcrossRotation proves that a Tail-created LogWatcher
+// (which never shares a LogFile with whatever is actually rotating the
+// file) still picks up lines written after a rotation, since reopenIfRotated
+// detects the rotation via stat identity rather than an in-process signal.
+func TestTailFollowAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	if err := os.WriteFile(name, []byte("before-rotate\n"), 0660); err != nil {
+		t.Fatalf("seed file: %s", err)
+	}
+
+	lw := Tail(name, ReadOptions{Follow: true})
+	defer lw.Close()
+
+	select {
+	case line := <-lw.Msgs:
+		if line != "before-rotate" {
+			t.Fatalf("got %q, want %q", line, "before-rotate")
+		}
+	case err := <-lw.Err:
+		t.Fatalf("ReadLogs error: %s", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for pre-rotation line")
+	}
+
+	// Simulate what intRotate does: move the active file aside and open a
+	// fresh one in its place, as a completely separate writer (or even a
+	// separate process) would.
+	if err := os.Rename(name, name+".0001"); err != nil {
+		t.Fatalf("rename: %s", err)
+	}
+	if err := os.WriteFile(name, []byte("after-rotate\n"), 0660); err != nil {
+		t.Fatalf("recreate file: %s", err)
+	}
+
+	select {
+	case line := <-lw.Msgs:
+		if line != "after-rotate" {
+			t.Fatalf("got %q, want %q", line, "after-rotate")
+		}
+	case err := <-lw.Err:
+		t.Fatalf("ReadLogs error: %s", err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for post-rotation line; follow did not survive rotation")
+	}
+}
+
+// TestLogFileRotateNameFuncRespectsMaxFiles proves that SetMaxFiles still
+// bounds disk usage once a custom RotateNameFunc is configured, instead
+// of archives accumulating forever (renameNamed, unlike the numeric
+// scheme, never shifts/removes files itself).
+func TestLogFileRotateNameFuncRespectsMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	lf := NewLogFile(name, true).SetRotateNameFunc(DateRotateName).SetMaxFiles(3)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+
+	const rotations = 10
+	for i := 0; i < rotations; i++ {
+		if err := lf.WriteRecord(&LogRecord{Message: "line"}); err != nil {
+			t.Fatalf("WriteRecord: %s", err)
+		}
+		if err := lf.Rotate(); err != nil {
+			t.Fatalf("Rotate %d: %s", i, err)
+		}
+	}
+	lf.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+
+	var archives []string
+	for _, e := range entries {
+		if e.Name() != "app.log" && e.Name() != "app.log.state" {
+			archives = append(archives, e.Name())
+		}
+	}
+	sort.Strings(archives)
+
+	if len(archives) != 3 {
+		t.Fatalf("got %d archived files %v, want 3 (SetMaxFiles(3) not enforced under RotateNameFunc)", len(archives), archives)
+	}
+}
+
+// TestCompressFileGzipsAndRemovesOriginal exercises compressFile directly
+// (it normally runs on its own goroutine kicked off by intRotate), proving
+// the rotated segment's content survives the gzip/atomic-rename dance and
+// the uncompressed original is gone afterward.
+func TestCompressFileGzipsAndRemovesOriginal(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log.0001")
+	want := "line one\nline two\n"
+
+	if err := os.WriteFile(name, []byte(want), 0660); err != nil {
+		t.Fatalf("seed file: %s", err)
+	}
+
+	compressFile(name)
+
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("original still present after compress: err=%v", err)
+	}
+	if _, err := os.Stat(name + ".gz.tmp"); !os.IsNotExist(err) {
+		t.Fatalf("tmp file left behind: err=%v", err)
+	}
+
+	gf, err := os.Open(name + ".gz")
+	if err != nil {
+		t.Fatalf("open .gz: %s", err)
+	}
+	defer gf.Close()
+
+	gr, err := gzip.NewReader(gf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %s", err)
+	}
+	defer gr.Close()
+
+	got, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatalf("read gz content: %s", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestLogFileCompressAndRotate drives SetCompress through a real rotation
+// and waits for the background compressFile goroutine to finish, proving
+// the .gz lands next to the active file under its numeric rotated name
+// and the uncompressed archive is gone.
+func TestLogFileCompressAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	lf := NewLogFile(name, true).SetCompress(true)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if err := lf.WriteRecord(&LogRecord{Message: "line"}); err != nil {
+		t.Fatalf("WriteRecord: %s", err)
+	}
+	if err := lf.Rotate(); err != nil {
+		t.Fatalf("Rotate: %s", err)
+	}
+	lf.Close()
+
+	gzPath := filepath.Join(dir, "app.log.0001.gz")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(gzPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never appeared; compressFile goroutine didn't finish", gzPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app.log.0001")); !os.IsNotExist(err) {
+		t.Fatalf("uncompressed archive still present: err=%v", err)
+	}
+}
+
+// TestLogFileOpenReconcilesSizeAfterCrash proves that a stale sidecar
+// (written at the last rotation, before records that were then lost to a
+// crash) doesn't leave Open trusting a CurSize that undercounts the
+// actual file.
+func TestLogFileOpenReconcilesSizeAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	// Simulate: the sidecar was written at the last rotation claiming an
+	// empty file, then several records were appended and the process
+	// crashed before the next rotation could refresh it.
+	if err := writeFileLogState(name, fileLogState{CurSize: 0, CurLines: 0, OpenTime: time.Now()}); err != nil {
+		t.Fatalf("writeFileLogState: %s", err)
+	}
+	content := strings.Repeat("x", 50) + "\n"
+	if err := os.WriteFile(name, []byte(content), 0660); err != nil {
+		t.Fatalf("seed file: %s", err)
+	}
+
+	lf := NewLogFile(name, true).SetRotateSize(len(content) - 1)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer lf.Close()
+
+	if lf.maxsize_cursize != len(content) {
+		t.Fatalf("maxsize_cursize = %d after Open, want %d (stale sidecar size wasn't reconciled against the real file)", lf.maxsize_cursize, len(content))
+	}
+
+	// With the stale sidecar (CurSize=0) trusted as-is, this write
+	// wouldn't have rotated until the file grew to roughly 2x maxsize.
+	if err := lf.WriteRecord(&LogRecord{Message: "trigger"}); err != nil {
+		t.Fatalf("WriteRecord: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app.log.0001")); err != nil {
+		t.Fatalf("expected rotation to fire off the reconciled size, not the stale sidecar value: %s", err)
+	}
+}
+
+// TestLogFileSkipsLineCountWhenMaxLinesUnset proves that the non-forced
+// rotation check Open runs on an existing file (with no sidecar to trust)
+// never scans the file for its line count when MaxLines is unset: the
+// persisted sidecar's CurLines stays 0 even though the file already has
+// several lines in it.
+func TestLogFileSkipsLineCountWhenMaxLinesUnset(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	lf := NewLogFile(name, true).SetRotateSize(1 << 20)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := lf.WriteRecord(&LogRecord{Message: "line"}); err != nil {
+			t.Fatalf("WriteRecord %d: %s", i, err)
+		}
+	}
+	lf.Close()
+
+	// Drop the sidecar so the next Open runs the rotation check on the
+	// existing file instead of picking up saved counters. A forced
+	// rotation would reset CurLines to 0 whether or not lines were counted.
+	if err := os.Remove(stateFileName(name)); err != nil {
+		t.Fatalf("remove sidecar: %s", err)
+	}
+
+	lf = NewLogFile(name, true).SetRotateSize(1 << 20)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	lf.Close()
+
+	st, err := readFileLogState(name)
+	if err != nil {
+		t.Fatalf("readFileLogState: %s", err)
+	}
+	if st.CurLines != 0 {
+		t.Fatalf("persisted CurLines = %d, want 0 (lineCount should be skipped when MaxLines is unset)", st.CurLines)
+	}
+}
+
+// TestLogFileRotateHourlyTriggersOnHourChange proves SetRotateHourly
+// rotates once the wall-clock hour no longer matches the hour the active
+// segment was opened in.
+func TestLogFileRotateHourlyTriggersOnHourChange(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	lf := NewLogFile(name, true).SetRotateHourly(true)
+	if err := lf.Open(); err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer lf.Close()
+
+	// Simulate the segment having been opened in an earlier hour, without
+	// waiting for a real hour boundary.
+	lf.hourly_opendate = (time.Now().Hour() + 23) % 24
+
+	if err := lf.WriteRecord(&LogRecord{Message: "line"}); err != nil {
+		t.Fatalf("WriteRecord: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app.log.0001")); err != nil {
+		t.Fatalf("expected an hourly rotation before this write: %s", err)
+	}
+	if lf.hourly_opendate != time.Now().Hour() {
+		t.Fatalf("hourly_opendate = %d after rotation, want the current hour", lf.hourly_opendate)
+	}
+}
+
+// TestPurgeOldFilesFollowsSymlinkedDir proves purgeOldFiles resolves a
+// symlinked log directory before walking it (filepath.Walk does not
+// follow symlinks on its own).
+func TestPurgeOldFilesFollowsSymlinkedDir(t *testing.T) {
+	real := filepath.Join(t.TempDir(), "real")
+	if err := os.Mkdir(real, 0770); err != nil {
+		t.Fatalf("Mkdir: %s", err)
+	}
+
+	linked := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(real, linked); err != nil {
+		t.Fatalf("Symlink: %s", err)
+	}
+
+	oldArchive := filepath.Join(real, "app.log.0001")
+	if err := os.WriteFile(oldArchive, []byte("old"), 0660); err != nil {
+		t.Fatalf("seed archive: %s", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(oldArchive, old, old); err != nil {
+		t.Fatalf("Chtimes: %s", err)
+	}
+
+	fileName := filepath.Join(linked, "app.log")
+	if err := purgeOldFiles(fileName, time.Hour); err != nil {
+		t.Fatalf("purgeOldFiles: %s", err)
+	}
+
+	if _, err := os.Stat(oldArchive); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive behind the symlinked dir to be purged, got err=%v", err)
+	}
+}
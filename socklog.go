@@ -8,63 +8,334 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// SocketFormat selects how LogRecords are framed on the wire.
+type SocketFormat int
+
+const (
+	// SocketFormatJSON marshals each record with encoding/json. This is
+	// the historical behavior of NewSocketLogWriter.
+	SocketFormatJSON SocketFormat = iota
+	// SocketFormatNDJSON renders each record with JSONFormatter (the
+	// ts/level/src/msg/fields shape) followed by a newline, which
+	// line-oriented collectors reading a TCP stream need in order to
+	// delimit records.
+	SocketFormatNDJSON
+	// SocketFormatSyslog frames each record as RFC5424:
+	// "<PRI>1 TIMESTAMP HOST APP PROCID MSGID - MSG".
+	SocketFormatSyslog
+)
+
+// SocketConfig configures a SocketLogWriter created via
+// NewSocketLogWriterConfig.
+type SocketConfig struct {
+	Proto    string
+	Hostport string
+
+	// Format selects the wire framing. Defaults to SocketFormatJSON.
+	Format SocketFormat
+
+	// Reconnect redials the socket with exponential backoff when a write
+	// fails, instead of closing the writer.
+	Reconnect bool
+	// ReconnectOnMsg defers redialing until the next message needs to be
+	// sent, instead of redialing in the background as soon as the socket
+	// drops.
+	ReconnectOnMsg bool
+	// MaxReconnectAttempts caps the number of redial attempts in one
+	// round of redialing. Once a round gives up, records keep going to
+	// the backlog and the next record written starts a new round. 0 means
+	// retry forever.
+	MaxReconnectAttempts int
+	// MaxReconnectDelay caps the exponential backoff between redial
+	// attempts. Defaults to 30s.
+	MaxReconnectDelay time.Duration
+
+	// BacklogSize caps the number of records buffered in memory while
+	// the socket is down; the oldest records are dropped once it fills.
+	// Defaults to LogBufferLength.
+	BacklogSize int
+}
+
 // This log writer sends output to a socket
 type SocketLogWriter struct {
 	rec       chan *LogRecord
 	closeSync *sync.WaitGroup
+
+	// format is the live SocketFormat, read by run on every write. It
+	// starts at cfg.Format but, unlike the rest of SocketConfig, can be
+	// changed after construction via SetFormat/SetJSONFormat.
+	format int32
 }
 
 // This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
 	w.rec <- rec
 }
 
-func (w SocketLogWriter) SelCloseSync(closeSync *sync.WaitGroup) {
+func (w *SocketLogWriter) SelCloseSync(closeSync *sync.WaitGroup) {
 	w.closeSync = closeSync
 }
 
-func (w SocketLogWriter) Close() {
+func (w *SocketLogWriter) Close() {
 	close(w.rec)
 }
 
+// NewSocketLogWriter creates a new LogWriter which sends output to a
+// socket established with net.Dial. It is a thin wrapper around
+// NewSocketLogWriterConfig using the historical defaults: JSON framing
+// and no reconnect.
 func NewSocketLogWriter(proto, hostport string) *SocketLogWriter {
-	sock, err := net.Dial(proto, hostport)
+	return NewSocketLogWriterConfig(SocketConfig{
+		Proto:    proto,
+		Hostport: hostport,
+	})
+}
+
+// NewSocketLogWriterConfig creates a new LogWriter which sends output to
+// a socket, with reconnect, buffering, and framing behavior controlled by
+// cfg. If cfg.Reconnect is false, a dial failure at construction time is
+// fatal and NewSocketLogWriterConfig returns nil, matching the historical
+// behavior of NewSocketLogWriter.
+func NewSocketLogWriterConfig(cfg SocketConfig) *SocketLogWriter {
+	if cfg.MaxReconnectDelay <= 0 {
+		cfg.MaxReconnectDelay = 30 * time.Second
+	}
+	if cfg.BacklogSize <= 0 {
+		cfg.BacklogSize = LogBufferLength
+	}
+
+	sock, err := net.Dial(cfg.Proto, cfg.Hostport)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
-		return nil
+		if !cfg.Reconnect {
+			fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", cfg.Hostport, err)
+			return nil
+		}
+		sock = nil
 	}
 
 	w := &SocketLogWriter{
-		rec: make(chan *LogRecord, LogBufferLength),
+		rec:    make(chan *LogRecord, LogBufferLength),
+		format: int32(cfg.Format),
 	}
 
-	go func() {
-		defer func() {
-			if sock != nil && proto == "tcp" {
-				sock.Close()
-			}
-			if w.closeSync != nil {
-				w.closeSync.Done()
-			}
-		}()
+	go w.run(cfg, sock)
 
-		for rec := range w.rec {
-			// Marshall into JSON
-			js, err := json.Marshal(rec)
-			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+	return w
+}
+
+// run owns the socket for the lifetime of w. It buffers records in
+// backlog whenever the socket is unavailable, and drains the backlog
+// before resuming normal writes once it reconnects.
+func (w *SocketLogWriter) run(cfg SocketConfig, sock net.Conn) {
+	var backlog [][]byte
+	var reconnecting chan net.Conn
+
+	defer func() {
+		if sock != nil {
+			sock.Close()
+		}
+		if w.closeSync != nil {
+			w.closeSync.Done()
+		}
+	}()
+
+	startReconnect := func() {
+		if reconnecting != nil {
+			return
+		}
+		reconnecting = make(chan net.Conn, 1)
+		go func(ch chan<- net.Conn) { ch <- w.dial(cfg) }(reconnecting)
+	}
+
+	if sock == nil && cfg.Reconnect {
+		startReconnect()
+	}
+
+	for {
+		select {
+		case rec, ok := <-w.rec:
+			if !ok {
 				return
 			}
 
-			_, err = sock.Write(js)
+			payload, err := encodeSocketRecord(SocketFormat(atomic.LoadInt32(&w.format)), rec)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
+				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", cfg.Hostport, err)
+				continue
+			}
+
+			backlog = append(backlog, payload)
+			if len(backlog) > cfg.BacklogSize {
+				backlog = backlog[len(backlog)-cfg.BacklogSize:]
+			}
+
+			if sock == nil && cfg.ReconnectOnMsg {
+				sock = w.dial(cfg)
+			}
+			if sock == nil {
+				if !cfg.Reconnect {
+					return
+				}
+				if !cfg.ReconnectOnMsg {
+					startReconnect()
+				}
+				continue
+			}
+
+			sock, backlog = w.flushBacklog(cfg, sock, backlog)
+			if sock == nil {
+				if !cfg.Reconnect {
+					return
+				}
+				if !cfg.ReconnectOnMsg {
+					startReconnect()
+				}
+			}
+
+		case conn := <-reconnecting:
+			reconnecting = nil
+			sock = conn
+			if sock == nil {
+				if !cfg.Reconnect {
+					return
+				}
+				// This round gave up after MaxReconnectAttempts; the next
+				// record starts a new one.
+				continue
+			}
+
+			sock, backlog = w.flushBacklog(cfg, sock, backlog)
+			if sock == nil {
+				if !cfg.Reconnect {
+					return
+				}
+				startReconnect()
 			}
 		}
-	}()
+	}
+}
 
+// SetFormat changes the wire framing (chainable). Unlike SocketConfig.Format,
+// this can be called at any time, including after the writer is already
+// running; the next record written picks up the new framing. Safe for
+// concurrent use.
+func (w *SocketLogWriter) SetFormat(format SocketFormat) *SocketLogWriter {
+	atomic.StoreInt32(&w.format, int32(format))
 	return w
 }
+
+// SetJSONFormat toggles the writer between NDJSON framing (true) and the
+// default SocketFormatJSON framing (false), mirroring
+// FileLogWriter.SetJSONFormat's plain on/off behavior. Use SetFormat
+// directly to select SocketFormatSyslog. Unlike FileLogWriter's version,
+// this can be called at any time, including after the writer is already
+// running. Safe for concurrent use.
+func (w *SocketLogWriter) SetJSONFormat(enableNDJSON bool) *SocketLogWriter {
+	if enableNDJSON {
+		return w.SetFormat(SocketFormatNDJSON)
+	}
+	return w.SetFormat(SocketFormatJSON)
+}
+
+// dial attempts to (re)establish the socket, backing off exponentially up
+// to cfg.MaxReconnectDelay between attempts. It gives up after
+// cfg.MaxReconnectAttempts tries (0 means retry forever) and returns nil.
+func (w *SocketLogWriter) dial(cfg SocketConfig) net.Conn {
+	delay := 100 * time.Millisecond
+
+	for attempt := 1; cfg.MaxReconnectAttempts <= 0 || attempt <= cfg.MaxReconnectAttempts; attempt++ {
+		sock, err := net.Dial(cfg.Proto, cfg.Hostport)
+		if err == nil {
+			return sock
+		}
+
+		fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", cfg.Hostport, err)
+
+		time.Sleep(delay)
+		delay *= 2
+		if delay > cfg.MaxReconnectDelay {
+			delay = cfg.MaxReconnectDelay
+		}
+	}
+
+	return nil
+}
+
+// flushBacklog writes buffered records to sock in order, stopping at the
+// first failure. It returns the (possibly closed) socket and whatever
+// remains unwritten.
+func (w *SocketLogWriter) flushBacklog(cfg SocketConfig, sock net.Conn, backlog [][]byte) (net.Conn, [][]byte) {
+	for len(backlog) > 0 {
+		if _, err := sock.Write(backlog[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", cfg.Hostport, err)
+			sock.Close()
+			return nil, backlog
+		}
+		backlog = backlog[1:]
+	}
+	return sock, backlog
+}
+
+// encodeSocketRecord renders rec according to format, adding framing as
+// needed.
+//
+// SocketFormatJSON preserves the writer's historical behavior byte for
+// byte: json.Marshal(rec) with no trailing newline. SocketFormatNDJSON is
+// the new structured shape instead, going through JSONFormatter (the same
+// one SetJSONFormat uses on FileLogWriter) with the newline NDJSON needs
+// to delimit records on a stream.
+func encodeSocketRecord(format SocketFormat, rec *LogRecord) ([]byte, error) {
+	switch format {
+	case SocketFormatSyslog:
+		return syslogFrame(rec), nil
+	case SocketFormatNDJSON:
+		return JSONFormatter{}.Format(rec)
+	default: // SocketFormatJSON
+		return json.Marshal(rec)
+	}
+}
+
+// syslogFrame renders rec as an RFC5424 syslog message:
+// "<PRI>1 TIMESTAMP HOST APP PROCID MSGID - MSG".
+func syslogFrame(rec *LogRecord) []byte {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "-"
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s - %s\n",
+		syslogPriority(rec.Level),
+		rec.Created.Format(time.RFC3339),
+		host,
+		rec.Source,
+		os.Getpid(),
+		"-",
+		rec.Message,
+	))
+}
+
+// syslogPriority maps a log4go level to an RFC5424 PRI value, combining
+// facility "user" (1) with the closest syslog severity.
+func syslogPriority(level Level) int {
+	const facility = 1 << 3 // user-level messages
+
+	var severity int
+	switch {
+	case level >= CRITICAL:
+		severity = 2 // crit
+	case level >= ERROR:
+		severity = 3 // err
+	case level >= WARNING:
+		severity = 4 // warning
+	case level >= INFO:
+		severity = 6 // info
+	default:
+		severity = 7 // debug
+	}
+
+	return facility + severity
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2010, Kyle Lemons <kyle@kylelemons.net>.  All rights reserved.
+
+package log4go
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeSocketRecordLegacyJSONUnchanged(t *testing.T) {
+	rec := &LogRecord{Level: INFO, Source: "pkg/file.go:12", Message: "hello"}
+
+	got, err := encodeSocketRecord(SocketFormatJSON, rec)
+	if err != nil {
+		t.Fatalf("encodeSocketRecord: %s", err)
+	}
+
+	want, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("json.Marshal: %s", err)
+	}
+
+	if string(got) != string(want) {
+		t.Fatalf("SocketFormatJSON changed shape:\n got  %s\n want %s", got, want)
+	}
+	if strings.HasSuffix(string(got), "\n") {
+		t.Fatal("SocketFormatJSON gained a trailing newline; historical framing has none")
+	}
+}
+
+func TestEncodeSocketRecordNDJSONUsesJSONFormatter(t *testing.T) {
+	rec := &LogRecord{Level: INFO, Source: "pkg/file.go:12", Message: "hello"}
+
+	got, err := encodeSocketRecord(SocketFormatNDJSON, rec)
+	if err != nil {
+		t.Fatalf("encodeSocketRecord: %s", err)
+	}
+	if !strings.HasSuffix(string(got), "\n") {
+		t.Fatal("SocketFormatNDJSON should end in a newline")
+	}
+
+	want, err := JSONFormatter{}.Format(rec)
+	if err != nil {
+		t.Fatalf("JSONFormatter.Format: %s", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestSocketLogWriterSetJSONFormatTogglesDefaultNotSyslog(t *testing.T) {
+	w := &SocketLogWriter{}
+	w.SetJSONFormat(true)
+	if SocketFormat(w.format) != SocketFormatNDJSON {
+		t.Fatalf("SetJSONFormat(true) = %v, want SocketFormatNDJSON", w.format)
+	}
+
+	w.SetJSONFormat(false)
+	if SocketFormat(w.format) != SocketFormatJSON {
+		t.Fatalf("SetJSONFormat(false) = %v, want SocketFormatJSON, not syslog", w.format)
+	}
+}
+
+func TestSocketLogWriterDialGivesUpAfterMaxAttempts(t *testing.T) {
+	// Nothing listens on this port.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := &SocketLogWriter{}
+	cfg := SocketConfig{
+		Proto:                "tcp",
+		Hostport:             addr,
+		MaxReconnectAttempts: 2,
+		MaxReconnectDelay:    5 * time.Millisecond,
+	}
+
+	done := make(chan net.Conn, 1)
+	go func() { done <- w.dial(cfg) }()
+
+	select {
+	case conn := <-done:
+		if conn != nil {
+			t.Fatal("dial should give up and return nil once nothing is listening")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("dial did not give up within MaxReconnectAttempts")
+	}
+}
+
+func TestSocketLogWriterDialSucceedsOnceListenerAppears(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close() // closed for now; dial should retry until it's back
+
+	accepted := make(chan struct{})
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		ln2, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		defer ln2.Close()
+		conn, err := ln2.Accept()
+		if err == nil {
+			conn.Close()
+			close(accepted)
+		}
+	}()
+
+	w := &SocketLogWriter{}
+	cfg := SocketConfig{
+		Proto:             "tcp",
+		Hostport:          addr,
+		MaxReconnectDelay: 10 * time.Millisecond,
+	}
+
+	done := make(chan net.Conn, 1)
+	go func() { done <- w.dial(cfg) }()
+
+	select {
+	case conn := <-done:
+		if conn == nil {
+			t.Fatal("dial gave up, want it to retry until the listener came back")
+		}
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("dial never connected once the listener reappeared")
+	}
+
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("listener never saw the expected connection")
+	}
+}
+
+// TestSocketLogWriterReconnectsAndFlushesBacklog drives a real
+// SocketLogWriter through a dropped connection and proves it redials and
+// replays what it buffered while the socket was down.
+func TestSocketLogWriterReconnectsAndFlushesBacklog(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer ln.Close()
+
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+		}
+	}()
+
+	w := NewSocketLogWriterConfig(SocketConfig{
+		Proto:             "tcp",
+		Hostport:          ln.Addr().String(),
+		Reconnect:         true,
+		MaxReconnectDelay: 10 * time.Millisecond,
+	})
+	if w == nil {
+		t.Fatal("NewSocketLogWriterConfig returned nil")
+	}
+	defer w.Close()
+
+	first := <-conns
+	r := bufio.NewReader(first)
+
+	w.LogWrite(&LogRecord{Message: "before-drop"})
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line := mustContainSoon(t, r, "before-drop")
+	_ = line
+
+	first.Close() // simulate the connection dying under the writer
+
+	// Keep writing until the writer notices the socket is down and
+	// redials; exactly how many attempts that takes depends on the local
+	// network stack's half-close behavior.
+	deadline := time.Now().Add(2 * time.Second)
+	var second net.Conn
+	for time.Now().Before(deadline) {
+		w.LogWrite(&LogRecord{Message: "during-outage"})
+		select {
+		case second = <-conns:
+		case <-time.After(50 * time.Millisecond):
+			continue
+		}
+		break
+	}
+	if second == nil {
+		t.Fatal("writer never redialed after the connection dropped")
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	mustContainSoon(t, bufio.NewReader(second), "during-outage")
+}
+
+// mustContainSoon reads from r until it sees want or the read fails,
+// returning everything read up to and including the match.
+func mustContainSoon(t *testing.T, r *bufio.Reader, want string) string {
+	t.Helper()
+
+	buf := make([]byte, 0, 256)
+	tmp := make([]byte, 256)
+	for {
+		n, err := r.Read(tmp)
+		buf = append(buf, tmp[:n]...)
+		if strings.Contains(string(buf), want) {
+			return string(buf)
+		}
+		if err != nil {
+			t.Fatalf("read: %s (got %q so far, want it to contain %q)", err, buf, want)
+		}
+	}
+}